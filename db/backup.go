@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	sqlite "github.com/mattn/go-sqlite3"
+)
+
+// Backup periodically copies mem.sessionActivity out to disk using
+// SQLite's online backup API (sqlite3_backup_*), so session activity
+// survives process restarts even though it's recorded against the
+// in-memory "mem" schema attached in New.
+type Backup struct {
+	edDb     *EdDb
+	backupDb *sql.DB
+
+	// memConn and diskConn are checked out for Backup's whole lifetime
+	// and never returned to their pool, so database/sql's own idle-conn
+	// churn (e.g. SetMaxIdleConns shrinking the idle set) can never close
+	// the raw driver connection backing memRaw/diskRaw out from under a
+	// copy in progress. sqlite3.SQLiteConn.Backup needs both ends to stay
+	// open for as long as the *SQLiteBackup built from them is in use.
+	memConn  *sql.Conn
+	memRaw   *sqlite.SQLiteConn
+	diskConn *sql.Conn
+	diskRaw  *sqlite.SQLiteConn
+
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// pinConn checks out a connection from db and never returns it to the
+// pool, so database/sql can't close or recycle it later, and unwraps its
+// underlying *sqlite3.SQLiteConn via Conn.Raw. Call Close on the
+// returned *sql.Conn to release it.
+func pinConn(ctx context.Context, db *sql.DB) (*sql.Conn, *sqlite.SQLiteConn, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var raw *sqlite.SQLiteConn
+	if err := conn.Raw(func(driverConn interface{}) error {
+		raw = driverConn.(*sqlite.SQLiteConn)
+		return nil
+	}); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, raw, nil
+}
+
+// newBackup opens a dedicated on-disk database at backupFilename and
+// pins one connection against it and one against edDb's own dbConn (which
+// already has "mem" attached by the connection hook in New), then
+// restores any rows already on disk.
+func newBackup(edDb *EdDb, backupFilename string) (*Backup, error) {
+	ctx := context.Background()
+
+	backupDb, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?cache=shared&busy_timeout=60000", backupFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	// This has to match mem.sessionActivity's schema (see
+	// sql/schema/002_session_activity.sql) column-for-column: the backup
+	// API replaces the destination's whole schema with the source's, so
+	// the very first restore (while this table is still empty) overwrites
+	// the freshly-migrated mem schema with this one.
+	if _, err := backupDb.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS main.sessionActivity (
+            id INTEGER PRIMARY KEY,
+            personId INTEGER NOT NULL,
+            dateTime DATETIME DEFAULT CURRENT_TIMESTAMP
+        );`); err != nil {
+		backupDb.Close()
+		return nil, err
+	}
+
+	memConn, memRaw, err := pinConn(ctx, edDb.dbConn.DB)
+	if err != nil {
+		backupDb.Close()
+		return nil, err
+	}
+
+	diskConn, diskRaw, err := pinConn(ctx, backupDb)
+	if err != nil {
+		memConn.Close()
+		backupDb.Close()
+		return nil, err
+	}
+
+	b := &Backup{
+		edDb:     edDb,
+		backupDb: backupDb,
+		memConn:  memConn,
+		memRaw:   memRaw,
+		diskConn: diskConn,
+		diskRaw:  diskRaw,
+	}
+
+	if err := b.restore(); err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// BackupNow copies mem.sessionActivity to the on-disk backup file
+// immediately, blocking until the copy finishes. It locks edDb.writer for
+// the duration of the copy, the same lock UpsertPerson and
+// RecordSessionActivity serialize through, so sqlite3_backup_step never
+// runs concurrently with a write transaction on the connections it's
+// copying between.
+func (b *Backup) BackupNow() error {
+	if err := b.edDb.writer.lock(context.Background()); err != nil {
+		return err
+	}
+	defer b.edDb.writer.unlock()
+	return b.copy("mem")
+}
+
+// restore copies rows already on disk back into mem.sessionActivity so
+// activity recorded in a previous run isn't lost when EdDb is recreated.
+func (b *Backup) restore() error {
+	if err := b.edDb.writer.lock(context.Background()); err != nil {
+		return err
+	}
+	defer b.edDb.writer.unlock()
+	return b.copy("main")
+}
+
+// copy drives the actual sqlite3_backup_* calls between this Backup's
+// pinned connections. The backup API always copies a whole schema, which
+// for both "mem" and backupDb's "main" only ever holds sessionActivity.
+// srcSchema is "mem" to flush to disk, or "main" to restore from it.
+func (b *Backup) copy(srcSchema string) error {
+	var from, to *sqlite.SQLiteConn
+	var fromSchema, toSchema string
+	if srcSchema == "mem" {
+		from, to = b.memRaw, b.diskRaw
+		fromSchema, toSchema = "mem", "main"
+	} else {
+		from, to = b.diskRaw, b.memRaw
+		fromSchema, toSchema = "main", "mem"
+	}
+
+	backup, err := to.Backup(toSchema, from, fromSchema)
+	if err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+
+	if _, err := backup.Step(-1); err != nil {
+		backup.Finish()
+		return fmt.Errorf("backup: step: %w", err)
+	}
+	return backup.Finish()
+}
+
+// StartBackup runs BackupNow on a ticker until StopBackup is called.
+func (b *Backup) StartBackup(interval time.Duration) {
+	b.stop = make(chan struct{})
+	b.stopped = make(chan struct{})
+
+	go func() {
+		defer close(b.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := b.BackupNow(); err != nil {
+					fmt.Println("Backup:", err)
+				}
+			case <-b.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopBackup stops the ticker started by StartBackup and waits for the
+// current copy, if any, to finish. It's idempotent - calling it more than
+// once, or calling it when StartBackup was never called, is a no-op
+// after the first call.
+func (b *Backup) StopBackup() {
+	b.stopOnce.Do(func() {
+		if b.stop == nil {
+			return
+		}
+		close(b.stop)
+		<-b.stopped
+	})
+}
+
+// Close releases the backup's pinned connections and closes its
+// dedicated database.
+func (b *Backup) Close() {
+	if b.memConn != nil {
+		b.memConn.Close()
+	}
+	if b.diskConn != nil {
+		b.diskConn.Close()
+	}
+	b.backupDb.Close()
+}
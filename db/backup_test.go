@@ -0,0 +1,98 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestBackupSurvivesRestart simulates a crash and restart: record
+// activity against one EdDb, flush it to disk and close, then open a
+// fresh EdDb against the same disk file and check the row count restored
+// into mem.sessionActivity matches what was recorded before the restart.
+func TestBackupSurvivesRestart(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "ed.db")
+
+	edDb, err := New(dbFile)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if err := edDb.UpsertPerson(0, "Andy"); err != nil {
+		t.Fatalf("UpsertPerson: %v", err)
+	}
+
+	const wantRows = 10
+	for i := 0; i < wantRows; i++ {
+		if err := edDb.RecordSessionActivity(0); err != nil {
+			t.Fatalf("RecordSessionActivity: %v", err)
+		}
+	}
+
+	if err := edDb.BackupNow(); err != nil {
+		t.Fatalf("BackupNow: %v", err)
+	}
+	edDb.Close()
+
+	restarted, err := New(dbFile)
+	if err != nil {
+		t.Fatalf("New (restart): %v", err)
+	}
+	defer restarted.Close()
+
+	activity, err := restarted.QuerySessionActivity()
+	if err != nil {
+		t.Fatalf("QuerySessionActivity: %v", err)
+	}
+
+	var gotRows int64
+	for _, a := range activity {
+		gotRows += a.NumItems
+	}
+	if gotRows != wantRows {
+		t.Fatalf("got %d restored rows, want %d", gotRows, wantRows)
+	}
+}
+
+// TestBackupSurvivesPoolChurn shrinks and regrows dbConn's idle pool -
+// ordinary behavior database/sql can trigger on its own under load - and
+// checks BackupNow still works afterwards. Backup's memConn/diskConn are
+// checked out for Backup's own lifetime and never returned to the pool,
+// so pool churn must never invalidate the raw connection backing them.
+func TestBackupSurvivesPoolChurn(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "ed.db")
+
+	edDb, err := New(dbFile)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer edDb.Close()
+
+	edDb.dbConn.SetMaxIdleConns(0)
+	edDb.dbConn.SetMaxIdleConns(10)
+
+	if err := edDb.RecordSessionActivity(0); err != nil {
+		t.Fatalf("RecordSessionActivity: %v", err)
+	}
+
+	if err := edDb.BackupNow(); err != nil {
+		t.Fatalf("BackupNow after pool churn: %v", err)
+	}
+}
+
+// TestStopBackupIdempotent checks that StopBackup followed by Close - the
+// sequence Close itself performs - never panics, and neither does calling
+// StopBackup more than once directly.
+func TestStopBackupIdempotent(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "ed.db")
+
+	edDb, err := New(dbFile)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	edDb.StartBackup(time.Hour)
+	edDb.StopBackup()
+	edDb.StopBackup()
+	edDb.Close()
+}
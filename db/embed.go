@@ -0,0 +1,11 @@
+package db
+
+import "embed"
+
+// defaultSQL is the schema/ and queries/ tree shipped with the module, so
+// db.New("diskDb.db") keeps working without callers having to supply
+// their own embed.FS. Use NewWithFS to load schema and queries from
+// somewhere else instead.
+//
+//go:embed sql
+var defaultSQL embed.FS
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestTwoInstancesIsolated opens two EdDb instances concurrently and
+// checks that recording activity against one never shows up in the
+// other's mem.sessionActivity. Each EdDb gets its own connection-hook
+// driver and shared-cache memory DB name (see New), so the two never end
+// up attaching the same "mem" namespace.
+func TestTwoInstancesIsolated(t *testing.T) {
+	dir := t.TempDir()
+
+	var (
+		wg             sync.WaitGroup
+		one, two       *EdDb
+		oneErr, twoErr error
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		one, oneErr = New(filepath.Join(dir, "one.db"))
+	}()
+	go func() {
+		defer wg.Done()
+		two, twoErr = New(filepath.Join(dir, "two.db"))
+	}()
+	wg.Wait()
+
+	if oneErr != nil {
+		t.Fatalf("New(one): %v", oneErr)
+	}
+	if twoErr != nil {
+		t.Fatalf("New(two): %v", twoErr)
+	}
+	defer one.Close()
+	defer two.Close()
+
+	if err := one.UpsertPerson(0, "Andy"); err != nil {
+		t.Fatalf("UpsertPerson(one): %v", err)
+	}
+
+	const wantRows = 5
+	for i := 0; i < wantRows; i++ {
+		if err := one.RecordSessionActivity(0); err != nil {
+			t.Fatalf("RecordSessionActivity(one): %v", err)
+		}
+	}
+
+	oneActivity, err := one.QuerySessionActivity()
+	if err != nil {
+		t.Fatalf("QuerySessionActivity(one): %v", err)
+	}
+	twoActivity, err := two.QuerySessionActivity()
+	if err != nil {
+		t.Fatalf("QuerySessionActivity(two): %v", err)
+	}
+
+	var oneCount, twoCount int64
+	for _, a := range oneActivity {
+		oneCount += a.NumItems
+	}
+	for _, a := range twoActivity {
+		twoCount += a.NumItems
+	}
+
+	if oneCount != wantRows {
+		t.Fatalf("got %d rows in one, want %d", oneCount, wantRows)
+	}
+	if twoCount != 0 {
+		t.Fatalf("got %d rows in two, want 0 - mem tables are not isolated", twoCount)
+	}
+}
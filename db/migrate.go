@@ -0,0 +1,168 @@
+package db
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migration is one versioned file under schema/, e.g. 001_person.sql. The
+// file's leading "-- target: main" or "-- target: mem" comment says
+// which attached database it runs against; a file with no such comment
+// defaults to main.
+type migration struct {
+	version int
+	name    string
+	target  string
+	sql     string
+}
+
+// loadMigrations reads every *.sql file directly under sqlFS's schema/
+// directory and sorts them by their leading NNN_ version number.
+func loadMigrations(sqlFS fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(sqlFS, "schema")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read schema dir: %w", err)
+	}
+
+	migrations := make([]migration, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		version, err := parseMigrationVersion(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		contents, err := fs.ReadFile(sqlFS, "schema/"+entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrate: read %s: %w", entry.Name(), err)
+		}
+
+		migrations = append(migrations, migration{
+			version: version,
+			name:    entry.Name(),
+			target:  migrationTarget(string(contents)),
+			sql:     string(contents),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+func parseMigrationVersion(filename string) (int, error) {
+	prefix, _, ok := strings.Cut(filename, "_")
+	if !ok {
+		return 0, fmt.Errorf("migrate: %s has no NNN_ version prefix", filename)
+	}
+	version, err := strconv.Atoi(prefix)
+	if err != nil {
+		return 0, fmt.Errorf("migrate: %s has no NNN_ version prefix: %w", filename, err)
+	}
+	return version, nil
+}
+
+func migrationTarget(contents string) string {
+	firstLine, _, _ := strings.Cut(contents, "\n")
+	if rest, ok := strings.CutPrefix(strings.TrimSpace(firstLine), "-- target:"); ok {
+		return strings.TrimSpace(rest)
+	}
+	return "main"
+}
+
+// runMigrations applies every pending migration from sqlFS against
+// dbConn, in version order.
+//
+// main.schema_version tracks which "main" migrations have already run, so
+// they apply exactly once per disk database. "mem" migrations target the
+// in-memory database attached fresh by every new connection pool, so
+// they always run again rather than being tracked there - mem has no
+// rows to lose between runs.
+func runMigrations(dbConn *sqlx.DB, sqlFS fs.FS) error {
+	if _, err := dbConn.Exec(`CREATE TABLE IF NOT EXISTS main.schema_version (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("migrate: create schema_version: %w", err)
+	}
+
+	applied := map[int]bool{}
+	rows, err := dbConn.Query(`SELECT version FROM main.schema_version`)
+	if err != nil {
+		return fmt.Errorf("migrate: read schema_version: %w", err)
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return fmt.Errorf("migrate: scan schema_version: %w", err)
+		}
+		applied[version] = true
+	}
+	rows.Close()
+
+	migrations, err := loadMigrations(sqlFS)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.target == "main" && applied[m.version] {
+			continue
+		}
+
+		tx, err := dbConn.Beginx()
+		if err != nil {
+			return fmt.Errorf("migrate: begin %s: %w", m.name, err)
+		}
+
+		if _, err := tx.Exec(m.sql); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate: apply %s: %w", m.name, err)
+		}
+
+		if m.target == "main" {
+			if _, err := tx.Exec(`INSERT INTO main.schema_version (version) VALUES (?)`, m.version); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migrate: record %s: %w", m.name, err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migrate: commit %s: %w", m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// loadQueries reads every *.sql file directly under sqlFS's queries/
+// directory into a map keyed by filename without its extension, e.g.
+// queries/upsertPerson.sql becomes statements["upsertPerson"].
+func loadQueries(sqlFS fs.FS) (map[string]string, error) {
+	entries, err := fs.ReadDir(sqlFS, "queries")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read queries dir: %w", err)
+	}
+
+	queries := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		contents, err := fs.ReadFile(sqlFS, "queries/"+entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrate: read %s: %w", entry.Name(), err)
+		}
+
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		queries[name] = string(contents)
+	}
+
+	return queries, nil
+}
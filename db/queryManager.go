@@ -2,8 +2,12 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"io/fs"
+	"sync/atomic"
+
 	// sqlx is a superset of go's database/sql
 	"github.com/jmoiron/sqlx"
 	//sqlite driver for database/sql
@@ -12,34 +16,84 @@ import (
 	"time"
 )
 
+// instanceCounter hands out a unique ID to each EdDb so its connection
+// hook driver and shared-cache memory DB name never collide with another
+// EdDb's, letting New be called more than once in the same process (e.g.
+// once per test case).
+var instanceCounter int64
+
+func nextInstanceID() int64 {
+	return atomic.AddInt64(&instanceCounter, 1)
+}
+
 // EdDb provides database support for ed
 type EdDb struct {
 
 	// Database
 	dbConn *sqlx.DB
 
+	// queries holds the raw SQL loaded from the queries/ directory of the
+	// sql tree (sql/queries/ for New), keyed by filename without its
+	// extension.
+	queries map[string]string
+
 	// Prepared statements: prepared on dbConn but should be usable from memDb
 	statements map[string]*sqlx.NamedStmt
+
+	// writer serializes every write transaction so concurrent callers
+	// never race each other into SQLITE_BUSY.
+	writer *Writer
+
+	// backup periodically flushes mem.sessionActivity to dbFilename+".backup"
+	// so it survives process restarts. NewWithFS fails if newBackup does,
+	// so this is never nil on an EdDb it returns.
+	backup *Backup
 }
 
-// New tries to initialise the disk-based database and create memory
+// New tries to initialise the disk-based database and create memory,
+// loading schema migrations and queries from the module's own embedded
+// sql/ tree. Use NewWithFS to supply a different schema/queries tree.
 func New(dbFilename string) (*EdDb, error) {
+	sqlFS, err := fs.Sub(defaultSQL, "sql")
+	if err != nil {
+		return nil, err
+	}
+	return NewWithFS(dbFilename, sqlFS)
+}
+
+// NewWithFS is New, but loads schema migrations from a schema/ directory
+// and query definitions from a queries/ directory under sqlFS instead of
+// the module's default embedded sql/ tree.
+func NewWithFS(dbFilename string, sqlFS fs.FS) (*EdDb, error) {
+
+	// Every EdDb gets its own driver name and its own shared-cache memory
+	// DB name, derived from a process-wide instance counter. Without this,
+	// a second call to New would panic registering the same driver name
+	// twice, and two EdDb instances would otherwise share the same
+	// 'file::memory:' namespace and stomp on each other's sessionActivity
+	// table (see mattn/go-sqlite3 issue #204).
+	instanceID := nextInstanceID()
+	driverName := fmt.Sprintf("sqlite3_ed_%d", instanceID)
+	memDbName := fmt.Sprintf("file:ed_mem_%d?mode=memory&cache=shared&busy_timeout=60000", instanceID)
 
 	// First, create a hook which will attach a shared memory-only database to
 	// each connction opened by golang's database/sql connection pool
-	sql.Register("sqlite3ConnectionCatchingDriver",
+	sql.Register(driverName,
 		&sqlite.SQLiteDriver{
 			ConnectHook: func(newConn *sqlite.SQLiteConn) error {
-				newConn.Exec("ATTACH DATABASE 'file::memory:?cache=shared&busy_timeout=60000' AS mem", nil)
+				newConn.Exec(fmt.Sprintf("ATTACH DATABASE '%s' AS mem", memDbName), nil)
 				fmt.Println("Attach Database to ", newConn)
 				return nil
 			},
 		},
 	)
 
-	// The hook is now in place, so can create a connection to the disk Db:
-	dbURI := fmt.Sprintf("file:%s?cache=shared&busy_timeout=60000", dbFilename)
-	dbConn, err := sqlx.Connect("sqlite3ConnectionCatchingDriver", dbURI)
+	// The hook is now in place, so can create a connection to the disk Db.
+	// _txlock=immediate makes every BeginTx a BEGIN IMMEDIATE, so Writer
+	// takes the write lock upfront instead of upgrading a deferred
+	// transaction mid-flight and losing the race to another writer.
+	dbURI := fmt.Sprintf("file:%s?cache=shared&busy_timeout=60000&_txlock=immediate", dbFilename)
+	dbConn, err := sqlx.Connect(driverName, dbURI)
 	if err != nil {
 		return nil, err
 	}
@@ -50,164 +104,155 @@ func New(dbFilename string) (*EdDb, error) {
 	edDb := EdDb{
 		dbConn:     dbConn,
 		statements: map[string]*sqlx.NamedStmt{},
+		writer:     newWriter(dbConn),
+	}
+
+	if err := runMigrations(dbConn, sqlFS); err != nil {
+		dbConn.Close()
+		return nil, err
 	}
 
-	err = edDb.initDbSchema()
+	queries, err := loadQueries(sqlFS)
 	if err != nil {
 		dbConn.Close()
 		return nil, err
 	}
+	edDb.queries = queries
 
 	err = edDb.buildPreparedStatements()
 	if err != nil {
 		dbConn.Close()
 		return nil, err
 	}
+
+	backup, err := newBackup(&edDb, dbFilename+".backup")
+	if err != nil {
+		dbConn.Close()
+		return nil, err
+	}
+	edDb.backup = backup
+
 	return &edDb, nil
 }
 
+// StartBackup starts periodically flushing mem.sessionActivity to disk
+// every interval; call StopBackup to stop it.
+func (db *EdDb) StartBackup(interval time.Duration) {
+	db.backup.StartBackup(interval)
+}
+
+// StopBackup stops a backup loop started with StartBackup.
+func (db *EdDb) StopBackup() {
+	db.backup.StopBackup()
+}
+
+// BackupNow flushes mem.sessionActivity to disk immediately.
+func (db *EdDb) BackupNow() error {
+	return db.backup.BackupNow()
+}
+
 // Close tidies up everything
 func (db *EdDb) Close() {
 	// close prepared statements
-	for title := range db.preparedStatements() {
+	for title := range db.queries {
 		db.statements[title].Close()
 	}
 
+	db.backup.StopBackup()
+	db.backup.Close()
+
 	//close databases
 	db.dbConn.Close()
 	return
 }
 
-// UpsertPerson blah
-func (db *EdDb) UpsertPerson(id int, name string) (err error) {
+// UpsertPerson is UpsertPersonContext with context.Background().
+func (db *EdDb) UpsertPerson(id int, name string) error {
+	return db.UpsertPersonContext(context.Background(), id, name)
+}
+
+// UpsertPersonContext inserts person id/name if it doesn't exist yet, or
+// updates its name and bumps numUpdates if it does. ctx is honoured by
+// the underlying Writer, so a cancelled ctx aborts the pending
+// transaction instead of blocking for it.
+func (db *EdDb) UpsertPersonContext(ctx context.Context, id int, name string) error {
 	args := map[string]interface{}{
 		"id":   id,
 		"name": name,
 	}
-	_, err = db.statements["updatePerson"].Exec(args)
-	if err != nil {
-		log.Fatal("updatePerson: ", err)
-	}
-	_, err = db.statements["insertPerson"].Exec(args)
-	if err != nil {
-		log.Fatal("insertPerson: ", err)
-	}
-	return
+	return db.writer.Do(ctx, nil, func(tx *sqlx.Tx) error {
+		if _, err := tx.NamedStmt(db.statements["updatePerson"]).ExecContext(ctx, args); err != nil {
+			return fmt.Errorf("updatePerson: %w", err)
+		}
+		if _, err := tx.NamedStmt(db.statements["insertPerson"]).ExecContext(ctx, args); err != nil {
+			return fmt.Errorf("insertPerson: %w", err)
+		}
+		return nil
+	})
 }
 
-// RecordSessionActivity blah
-func (db *EdDb) RecordSessionActivity(personID int) (err error) {
+// RecordSessionActivity is RecordSessionActivityContext with context.Background().
+func (db *EdDb) RecordSessionActivity(personID int) error {
+	return db.RecordSessionActivityContext(context.Background(), personID)
+}
 
-	_, err = db.statements["recordSessionActivity"].Exec(map[string]interface{}{
-		"personId": personID,
+// RecordSessionActivityContext records one activity row for personID in
+// mem.sessionActivity. ctx is honoured by the underlying Writer, so a
+// cancelled ctx aborts the pending transaction instead of blocking for it.
+func (db *EdDb) RecordSessionActivityContext(ctx context.Context, personID int) error {
+	return db.writer.Do(ctx, nil, func(tx *sqlx.Tx) error {
+		if _, err := tx.NamedStmt(db.statements["recordSessionActivity"]).ExecContext(ctx, map[string]interface{}{
+			"personId": personID,
+		}); err != nil {
+			return fmt.Errorf("RecordSessionActivity: %w", err)
+		}
+		return nil
 	})
+}
 
-	if err != nil {
-		log.Fatal("RecordSessionActivity: ", err)
-	}
-	return
+// SessionActivity is one row of the sessionActivity-by-person report
+// built by QuerySessionActivity.
+type SessionActivity struct {
+	PersonID   int64     `db:"personId"`
+	PersonName string    `db:"personName"`
+	DateTime   time.Time `db:"dateTime"`
+	NumItems   int64     `db:"numItems"`
+}
+
+// QuerySessionActivity is QuerySessionActivityContext with context.Background().
+func (db *EdDb) QuerySessionActivity() ([]SessionActivity, error) {
+	return db.QuerySessionActivityContext(context.Background())
 }
 
-// PrintSessionActivity blah
-func (db *EdDb) PrintSessionActivity() (err error) {
-	rows, err := db.statements["getSessionActivity"].Query(map[string]interface{}{
+// QuerySessionActivityContext returns one SessionActivity per person with
+// recorded activity, so callers can render or test it without scraping
+// stdout.
+func (db *EdDb) QuerySessionActivityContext(ctx context.Context) ([]SessionActivity, error) {
+	rows, err := db.statements["getSessionActivity"].QueryxContext(ctx, map[string]interface{}{
 		"id":   1,
 		"name": "f",
 	})
 	if err != nil {
-		log.Fatal("PrintSessionActivity : ", err)
+		return nil, fmt.Errorf("QuerySessionActivity: %w", err)
 	}
+	defer rows.Close()
 
-	// iterate over each row
+	var activity []SessionActivity
 	for rows.Next() {
-		var personName string
-		var personID int64
-		var dateTime time.Time
-		var numItems int64
-		err = rows.Scan(&personName, &personID, &dateTime, &numItems)
-		fmt.Println("Result:", personID, personName, dateTime, numItems)
-	}
-
-	return
-}
-
-// initDbSchema initialises both the disk schema and the memory-only database,
-// which is created and attached immediately by the ATTACH command below
-// IMPORTANT! If you use the 'file::memory:?....' form rather than
-//                           'file:mem.db?mode=memory' form, then the memory
-// db will NOT be visible from all connections to the db. The file 'mem.db' does
-// not get created as long as mode=memory, but all go subroutines (accessing
-// via different connections) WILL be able to access the same memory db..
-
-func (db *EdDb) initDbSchema() (err error) {
-
-	// First, the persistent parts of the database (main.), then the
-	// ephemeral parts (mem.)
-	_, err = db.dbConn.Exec(`
-
-        CREATE TABLE IF NOT EXISTS main.person (
-            id INTEGER PRIMARY KEY,
-            name TEXT NOT NULL,
-            numUpdates INTEGER DEFAULT 0
-        );
-
-        CREATE TABLE mem.sessionActivity (
-            id INTEGER PRIMARY KEY,
-            personId INTEGER NOT NULL,
-            dateTime DATETIME DEFAULT CURRENT_TIMESTAMP
-        );
-    `)
-	return
-}
-
-func (db *EdDb) preparedStatements() map[string]string {
-	return map[string]string{
-
-		"insertPerson": `
-
-            INSERT OR IGNORE INTO person (id, name)
-            VALUES(:id, :name)
-            ;
-        `,
-
-		"updatePerson": `
-
-            UPDATE person SET
-                name=:name,
-                numUpdates=numUpdates + 1
-            WHERE
-                id=:id
-            ;
-        `,
-
-		"recordSessionActivity": `
-
-           INSERT INTO sessionActivity (personId)
-           VALUES(:personId);
-        `,
-
-		"getSessionActivity": `
-
-            SELECT
-               main.person.name as personName,
-               main.person.id as personId,
-               mem.sessionActivity.dateTime as dateTime,
-               count(*) as numItems
-           FROM mem.sessionActivity
-           LEFT OUTER JOIN main.person
-               ON mem.sessionActivity.personId = main.person.id
-           GROUP BY
-               main.person.id
-           ORDER BY
-               mem.sessionActivity.dateTime ASC
-        `,
+		var a SessionActivity
+		if err := rows.StructScan(&a); err != nil {
+			return nil, fmt.Errorf("QuerySessionActivity: scan: %w", err)
+		}
+		activity = append(activity, a)
 	}
+	return activity, rows.Err()
 }
 
-// BuildPreparedStatements builds prepared statements
+// BuildPreparedStatements builds prepared statements from the queries
+// loaded from the sql tree's queries/ directory (see loadQueries).
 func (db *EdDb) buildPreparedStatements() (err error) {
 
-	for title, sqlCommand := range db.preparedStatements() {
+	for title, sqlCommand := range db.queries {
 		db.statements[title], err = db.dbConn.PrepareNamed(sqlCommand)
 		if err != nil {
 			log.Fatal(fmt.Sprint("buildPreparedStatement:", title, " ", err))
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Writer serializes every write transaction against an EdDb behind a
+// single-slot semaphore, so the concurrent personPutter/sessionUpdater
+// goroutines in ed.go never race each other into SQLITE_BUSY. Reads are
+// left unsynchronized; SQLite's shared cache handles concurrent readers
+// fine on its own. A semaphore channel, rather than a sync.Mutex, is what
+// lets Do give up on a cancelled ctx while still waiting for its turn
+// instead of only noticing cancellation once it's holding the slot.
+type Writer struct {
+	sem chan struct{}
+	db  *sqlx.DB
+}
+
+func newWriter(db *sqlx.DB) *Writer {
+	return &Writer{sem: make(chan struct{}, 1), db: db}
+}
+
+// lock claims the Writer's single slot, or returns ctx's error if ctx is
+// done first. Every caller that succeeds must call unlock.
+func (w *Writer) lock(ctx context.Context) error {
+	select {
+	case w.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Writer) unlock() {
+	<-w.sem
+}
+
+// Do runs fn serialized against every other call to Do (and against
+// Backup's copies, which claim the same slot) on this Writer. If txn is
+// nil, Do begins its own transaction (the connection is opened with
+// _txlock=immediate, so this is a BEGIN IMMEDIATE and takes the write
+// lock upfront rather than upgrading a deferred one mid-flight) and
+// commits or rolls it back depending on fn's result. If txn is already
+// set, fn runs directly on it and the caller keeps ownership of its
+// lifecycle.
+func (w *Writer) Do(ctx context.Context, txn *sqlx.Tx, fn func(*sqlx.Tx) error) error {
+	if err := w.lock(ctx); err != nil {
+		return fmt.Errorf("writer: %w", err)
+	}
+	defer w.unlock()
+
+	if txn != nil {
+		return fn(txn)
+	}
+
+	tx, err := w.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("writer: begin: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("writer: commit: %w", err)
+	}
+	return nil
+}
@@ -18,7 +18,9 @@ var names = []string{
 func sessionUpdater(instanceNum int, numIterations int, edDb *db.EdDb, c chan string) {
 
 	for i := 0; i < numIterations; i++ {
-		edDb.RecordSessionActivity(0)
+		if err := edDb.RecordSessionActivity(0); err != nil {
+			fmt.Println("sessionUpdater", instanceNum, ":", err)
+		}
 	}
 	c <- fmt.Sprintf("sessionUpdater %d finished", instanceNum)
 }
@@ -27,7 +29,9 @@ func personPutter(instanceNum int, numIterations int, edDb *db.EdDb, c chan stri
 
 	for i := 0; i < numIterations; i++ {
 		which := rand.Intn(4)
-		edDb.UpsertPerson(which, names[which])
+		if err := edDb.UpsertPerson(which, names[which]); err != nil {
+			fmt.Println("personPutter", instanceNum, ":", err)
+		}
 	}
 	c <- fmt.Sprintf("dbPutter %d finished", instanceNum)
 }
@@ -66,7 +70,13 @@ func main() {
 		fmt.Println(<-c)
 	}
 
-	edDb.PrintSessionActivity()
+	activity, err := edDb.QuerySessionActivity()
+	if err != nil {
+		fmt.Println(err)
+	}
+	for _, a := range activity {
+		fmt.Println("Result:", a.PersonID, a.PersonName, a.DateTime, a.NumItems)
+	}
 
 	fmt.Printf("Finished!.\n")
 